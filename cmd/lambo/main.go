@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 
+	"github.com/archway-network/lambo/pkg/admin"
 	"github.com/archway-network/lambo/pkg/config"
 	"github.com/archway-network/lambo/pkg/manager"
 	"github.com/archway-network/lambo/pkg/proxy"
@@ -32,24 +34,71 @@ func main() {
 	}
 
 	// Define the pool of backend endpoints
-	pool := &manager.EndpointPool{Endpoints: make([]*manager.Endpoint, 0, len(cfg.BackendAddresses))}
+	pool := manager.NewEndpointPool()
+	pool.Endpoints = make([]*manager.Endpoint, 0, len(cfg.BackendAddresses))
+	pool.SetPolicy(manager.NewSelectionPolicy(cfg.SelectionPolicy))
 
 	// Populate the EndpointPool
 	for _, addr := range cfg.BackendAddresses {
 		pool.Endpoints = append(pool.Endpoints, manager.NewEndpoint(addr))
 	}
 
+	// cfgWatcher holds the live Config so HealthChecker, ProxyHandler, and
+	// reconcilePool below can pick up a SIGHUP/file-change reload without
+	// restarting the process. ProxyPort and AdminPort changes are the
+	// exception: both listeners below have already bound their ports by the
+	// time a reload can happen, so changing either still requires a restart.
+	cfgWatcher := config.NewWatcher(*configPath, cfg)
+	cfgWatcher.OnReload(func(old, newCfg *config.Config) {
+		reconcilePool(pool, old, newCfg)
+	})
+	watchCtx, cancelWatch := context.WithCancel(context.Background())
+	defer cancelWatch()
+	go cfgWatcher.Watch(watchCtx)
+
 	// 1. Start Management Layer routines
-	go manager.HealthChecker(pool, cfg)
+	go manager.HealthChecker(pool, cfgWatcher)
 	log.Println("HealthChecker started.")
 
-	// 2. Start Request Layer (Proxy Server)
+	// 2. Start Admin API (Prometheus metrics + pool introspection)
+	adminServer := admin.NewServer(pool, cfgWatcher)
+	adminAddr := fmt.Sprintf(":%d", cfg.AdminPort)
+	go func() {
+		if err := adminServer.ListenAndServe(adminAddr); err != nil {
+			log.Printf("Admin API failed: %v", err)
+		}
+	}()
+
+	// 3. Start Request Layer (Proxy Server)
 	proxyAddr := fmt.Sprintf(":%d", cfg.ProxyPort)
 	log.Printf("Starting Load Balancing Proxy on %s", proxyAddr)
 
-	http.HandleFunc("/", proxy.ProxyHandler(pool, cfg))
+	http.HandleFunc("/", proxy.ProxyHandler(pool, cfgWatcher))
 
 	if err := http.ListenAndServe(proxyAddr, nil); err != nil {
 		log.Fatalf("Proxy failed to start: %v", err)
 	}
 }
+
+// reconcilePool diffs new.BackendAddresses against the live pool: any
+// address no longer present is drained gracefully (see
+// EndpointPool.RemoveGracefully) and any address not yet in the pool is
+// added. Also swaps in a new SelectionPolicy if selection_policy changed.
+func reconcilePool(pool *manager.EndpointPool, old, newCfg *config.Config) {
+	wanted := make(map[string]bool, len(newCfg.BackendAddresses))
+	for _, addr := range newCfg.BackendAddresses {
+		ep := pool.Add(addr)
+		wanted[ep.Address] = true
+	}
+
+	for _, ep := range pool.Snapshot() {
+		if !wanted[ep.Address] {
+			pool.RemoveGracefully(ep.Address, newCfg.DrainTimeout)
+		}
+	}
+
+	if newCfg.SelectionPolicy != old.SelectionPolicy {
+		pool.SetPolicy(manager.NewSelectionPolicy(newCfg.SelectionPolicy))
+		log.Printf("[ConfigWatcher] selection_policy changed to %q", newCfg.SelectionPolicy.Type)
+	}
+}
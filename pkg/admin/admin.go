@@ -0,0 +1,255 @@
+// Package admin exposes a separate HTTP server for operational
+// introspection of an EndpointPool: Prometheus metrics and a small JSON
+// API for pool membership and liveness/readiness, independent of the main
+// proxy listener.
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/archway-network/lambo/pkg/config"
+	"github.com/archway-network/lambo/pkg/manager"
+)
+
+// Server is the admin HTTP server for a single EndpointPool.
+type Server struct {
+	Pool       *manager.EndpointPool
+	cfgWatcher *config.Watcher
+}
+
+// NewServer returns an admin Server for pool. cfgWatcher supplies the
+// DrainTimeout handleEndpoint's DELETE route uses for its default graceful
+// removal.
+func NewServer(pool *manager.EndpointPool, cfgWatcher *config.Watcher) *Server {
+	return &Server{Pool: pool, cfgWatcher: cfgWatcher}
+}
+
+// Handler builds the admin mux.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/pool", s.handlePool)
+	mux.HandleFunc("/livez", s.handleLivez)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/pool/endpoints", s.handleEndpoints)
+	mux.HandleFunc("/pool/endpoints/", s.handleEndpoint)
+	return mux
+}
+
+// ListenAndServe starts the admin server on addr (e.g. ":9090").
+func (s *Server) ListenAndServe(addr string) error {
+	log.Printf("[AdminServer] Starting admin API on %s", addr)
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// endpointSnapshot is the JSON representation of an Endpoint returned by
+// GET /pool and the pool mutation routes.
+type endpointSnapshot struct {
+	Address          string  `json:"address"`
+	Healthy          bool    `json:"healthy"`
+	Score            float64 `json:"score"`
+	LatencyMs        float64 `json:"latency_ms"`
+	ConsecutiveFails int     `json:"consecutive_fails"`
+	InFlight         int64   `json:"in_flight"`
+}
+
+func snapshotEndpoint(ep *manager.Endpoint) endpointSnapshot {
+	ep.Mutex.Lock()
+	snap := endpointSnapshot{
+		Address:          ep.Address,
+		Healthy:          ep.IsHealthy,
+		Score:            ep.Score,
+		LatencyMs:        ep.LatencyMs,
+		ConsecutiveFails: ep.ConsecutiveFails,
+	}
+	ep.Mutex.Unlock()
+
+	// InFlight locks ep.Mutex itself, so it must run after we've released
+	// it above.
+	snap.InFlight = ep.InFlight()
+	return snap
+}
+
+// handlePool serves GET /pool: a snapshot of every endpoint in the pool.
+func (s *Server) handlePool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	endpoints := s.Pool.Snapshot()
+	snapshots := make([]endpointSnapshot, 0, len(endpoints))
+	for _, ep := range endpoints {
+		snapshots = append(snapshots, snapshotEndpoint(ep))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// handleLivez serves GET /livez: always 200 once the process can answer.
+func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz serves GET /readyz: 503 once the pool has zero healthy
+// endpoints, mirroring etcd's split of liveness vs readiness.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	for _, ep := range s.Pool.Snapshot() {
+		ep.Mutex.Lock()
+		healthy := ep.IsHealthy
+		ep.Mutex.Unlock()
+		if healthy {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, "ready")
+			return
+		}
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintln(w, "no healthy endpoints")
+}
+
+// handleEndpoints serves POST /pool/endpoints: add a new endpoint.
+func (s *Server) handleEndpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Address == "" {
+		http.Error(w, `invalid request body, expected {"address": "host:port"}`, http.StatusBadRequest)
+		return
+	}
+
+	ep := s.Pool.Add(req.Address)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshotEndpoint(ep))
+}
+
+// handleEndpoint serves DELETE /pool/endpoints/{addr} and
+// POST /pool/endpoints/{addr}/drain.
+//
+// DELETE drains the endpoint (see EndpointPool.RemoveGracefully) rather
+// than dropping it outright, so in-flight requests finish and idle
+// keep-alive connections get closed instead of leaked -- the same
+// graceful-removal path a config reload uses for a backend that falls out
+// of BackendAddresses. Pass ?force=true to fall back to the old immediate
+// EndpointPool.Remove when an operator wants a backend gone right now.
+func (s *Server) handleEndpoint(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/pool/endpoints/")
+	if path == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if addr, isDrain := strings.CutSuffix(path, "/drain"); isDrain {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.Pool.Drain(addr) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Query().Get("force") == "true" {
+		if !s.Pool.Remove(path) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !s.Pool.RemoveGracefully(path, s.cfgWatcher.Config().DrainTimeout) {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleMetrics serves GET /metrics in Prometheus text exposition format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	endpoints := s.Pool.Snapshot()
+
+	fmt.Fprintln(w, "# HELP lambo_endpoint_score EWMA reliability score for the endpoint (0.0-1.0).")
+	fmt.Fprintln(w, "# TYPE lambo_endpoint_score gauge")
+	for _, ep := range endpoints {
+		ep.Mutex.Lock()
+		score := ep.Score
+		ep.Mutex.Unlock()
+		fmt.Fprintf(w, "lambo_endpoint_score{addr=%q} %g\n", ep.Address, score)
+	}
+
+	fmt.Fprintln(w, "# HELP lambo_endpoint_latency_ms Latest measured latency to the endpoint, in milliseconds.")
+	fmt.Fprintln(w, "# TYPE lambo_endpoint_latency_ms gauge")
+	for _, ep := range endpoints {
+		ep.Mutex.Lock()
+		latency := ep.LatencyMs
+		ep.Mutex.Unlock()
+		fmt.Fprintf(w, "lambo_endpoint_latency_ms{addr=%q} %g\n", ep.Address, latency)
+	}
+
+	fmt.Fprintln(w, "# HELP lambo_endpoint_healthy Whether the endpoint is currently eligible for selection.")
+	fmt.Fprintln(w, "# TYPE lambo_endpoint_healthy gauge")
+	for _, ep := range endpoints {
+		ep.Mutex.Lock()
+		healthy := ep.IsHealthy
+		ep.Mutex.Unlock()
+		fmt.Fprintf(w, "lambo_endpoint_healthy{addr=%q} %d\n", ep.Address, boolToInt(healthy))
+	}
+
+	fmt.Fprintln(w, "# HELP lambo_requests_total Total proxied requests per endpoint and response status.")
+	fmt.Fprintln(w, "# TYPE lambo_requests_total counter")
+	for _, ep := range endpoints {
+		for status, count := range ep.RequestTotals() {
+			fmt.Fprintf(w, "lambo_requests_total{addr=%q,status=%q} %d\n", ep.Address, statusLabel(status), count)
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP lambo_healthcheck_total Total active health check probes per endpoint and result.")
+	fmt.Fprintln(w, "# TYPE lambo_healthcheck_total counter")
+	for _, ep := range endpoints {
+		for result, count := range ep.HealthCheckTotals() {
+			fmt.Fprintf(w, "lambo_healthcheck_total{addr=%q,result=%q} %d\n", ep.Address, result, count)
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP lambo_in_flight Connections currently open to the endpoint, including idle keep-alive connections.")
+	fmt.Fprintln(w, "# TYPE lambo_in_flight gauge")
+	for _, ep := range endpoints {
+		fmt.Fprintf(w, "lambo_in_flight{addr=%q} %d\n", ep.Address, ep.InFlight())
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// statusLabel renders a request status code as a metric label value;
+// status 0 represents a transport-level error (no response received).
+func statusLabel(statusCode int) string {
+	if statusCode == 0 {
+		return "error"
+	}
+	return strconv.Itoa(statusCode)
+}
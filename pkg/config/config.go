@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"time"
 
 	"github.com/caarlos0/env/v9"
@@ -11,11 +12,63 @@ import (
 
 // Config holds all configuration for the load balancer.
 type Config struct {
-	ProxyPort           int           `yaml:"proxy_port" env:"PROXY_PORT" default:"8080"`
-	HealthCheckInterval time.Duration `yaml:"health_check_interval" env:"HEALTH_CHECK_INTERVAL" default:"5s"`
-	HealthCheckFailures int           `yaml:"health_check_failures" env:"HEALTH_CHECK_FAILURES" default:"3"`
-	EWMAAlpha           float64       `yaml:"ewma_alpha" env:"EWMA_ALPHA" default:"0.1"`
-	BackendAddresses    []string      `yaml:"backend_addresses" env:"BACKEND_ADDRESSES" envSeparator:","`
+	ProxyPort           int                   `yaml:"proxy_port" env:"PROXY_PORT" default:"8080"`
+	AdminPort           int                   `yaml:"admin_port" env:"ADMIN_PORT" default:"9090"`
+	HealthCheckInterval time.Duration         `yaml:"health_check_interval" env:"HEALTH_CHECK_INTERVAL" default:"5s"`
+	HealthCheckFailures int                   `yaml:"health_check_failures" env:"HEALTH_CHECK_FAILURES" default:"3"`
+	EWMAAlpha           float64               `yaml:"ewma_alpha" env:"EWMA_ALPHA" default:"0.1"`
+	BackendAddresses    []string              `yaml:"backend_addresses" env:"BACKEND_ADDRESSES" envSeparator:","`
+	SelectionPolicy     SelectionPolicyConfig `yaml:"selection_policy"`
+	HealthProbe         HealthProbeConfig     `yaml:"health_probe"`
+	PassiveHealth       PassiveHealthConfig   `yaml:"passive_health"`
+
+	// DrainTimeout bounds how long a backend removed from BackendAddresses
+	// by a config reload is given to finish its in-flight connections
+	// before manager.EndpointPool forces them closed and drops it.
+	DrainTimeout time.Duration `yaml:"drain_timeout" env:"DRAIN_TIMEOUT" default:"30s"`
+}
+
+// SelectionPolicyConfig configures how the proxy picks an endpoint among
+// the pool's healthy candidates for each request. Type selects one of
+// "ewma_wrc" (default), "round_robin", "random", "least_conn", "ip_hash",
+// "header_hash", or "first". Header is only consulted when Type is
+// "header_hash".
+type SelectionPolicyConfig struct {
+	Type   string `yaml:"type" env:"SELECTION_POLICY_TYPE" default:"ewma_wrc"`
+	Header string `yaml:"header" env:"SELECTION_POLICY_HEADER"`
+}
+
+// HealthProbeConfig configures how HealthChecker probes each backend. Type
+// selects one of "http" (default), "tendermint_status", or "jsonrpc".
+// Path, ExpectedStatus, and ExpectedBodyRegex only apply to the "http"
+// probe; Method only applies to the "jsonrpc" probe. MaxBlockLag applies to
+// both chain-aware probes and is ignored (no lag check) when <= 0, so set
+// max_block_lag: 0 explicitly in YAML (or the env var) to turn the check
+// off -- omitting the key entirely gets you the default of 10 instead (see
+// setDefaults, which only fills this in before the YAML/env value is
+// loaded, so an explicit 0 from either always wins).
+type HealthProbeConfig struct {
+	Type              string `yaml:"type" env:"HEALTH_PROBE_TYPE" default:"http"`
+	Path              string `yaml:"path" env:"HEALTH_PROBE_PATH" default:"/health"`
+	ExpectedStatus    int    `yaml:"expected_status" env:"HEALTH_PROBE_EXPECTED_STATUS" default:"200"`
+	ExpectedBodyRegex string `yaml:"expected_body_regex" env:"HEALTH_PROBE_EXPECTED_BODY_REGEX"`
+	Method            string `yaml:"method" env:"HEALTH_PROBE_METHOD" default:"eth_blockNumber"`
+	MaxBlockLag       int64  `yaml:"max_block_lag" env:"HEALTH_PROBE_MAX_BLOCK_LAG" default:"10"`
+}
+
+// PassiveHealthConfig configures pkg/proxy's passive health check /
+// circuit breaker, which reacts to observed request outcomes in
+// ModifyResponse/ErrorHandler far faster than the active
+// HealthCheckInterval probe loop. An endpoint whose recent failures exceed
+// MaxFails or whose p95 latency exceeds MaxLatency, within FailWindow, is
+// immediately pulled out of selection for Cooldown before a single
+// half-open trial request is let through.
+type PassiveHealthConfig struct {
+	MaxFails        int           `yaml:"max_fails" env:"PASSIVE_HEALTH_MAX_FAILS" default:"5"`
+	FailWindow      time.Duration `yaml:"fail_window" env:"PASSIVE_HEALTH_FAIL_WINDOW" default:"30s"`
+	UnhealthyStatus []int         `yaml:"unhealthy_status" env:"PASSIVE_HEALTH_UNHEALTHY_STATUS" envSeparator:","`
+	MaxLatency      time.Duration `yaml:"max_latency" env:"PASSIVE_HEALTH_MAX_LATENCY" default:"2s"`
+	Cooldown        time.Duration `yaml:"cooldown" env:"PASSIVE_HEALTH_COOLDOWN" default:"60s"`
 }
 
 // NewConfig loads configuration from the specified YAML file and environment variables.
@@ -64,6 +117,9 @@ func (c *Config) setDefaults() {
 	if c.ProxyPort == 0 {
 		c.ProxyPort = 8080
 	}
+	if c.AdminPort == 0 {
+		c.AdminPort = 9090
+	}
 	if c.HealthCheckInterval == 0 {
 		c.HealthCheckInterval = 5 * time.Second
 	}
@@ -80,6 +136,47 @@ func (c *Config) setDefaults() {
 			"rpc.osmosis.validatus.com:443",
 		}
 	}
+	if c.SelectionPolicy.Type == "" {
+		c.SelectionPolicy.Type = "ewma_wrc"
+	}
+	if c.HealthProbe.Type == "" {
+		c.HealthProbe.Type = "http"
+	}
+	if c.HealthProbe.Path == "" {
+		c.HealthProbe.Path = "/health"
+	}
+	if c.HealthProbe.ExpectedStatus == 0 {
+		c.HealthProbe.ExpectedStatus = 200
+	}
+	if c.HealthProbe.Method == "" {
+		c.HealthProbe.Method = "eth_blockNumber"
+	}
+	if c.HealthProbe.MaxBlockLag == 0 {
+		// Runs before the YAML file and env vars are loaded (see
+		// NewConfig), so this only ever supplies the default for a user
+		// who hasn't set max_block_lag at all -- an explicit
+		// max_block_lag: 0 decoded afterwards still sticks, which is what
+		// disables the lag check per HealthProbeConfig's doc comment.
+		c.HealthProbe.MaxBlockLag = 10
+	}
+	if c.PassiveHealth.MaxFails == 0 {
+		c.PassiveHealth.MaxFails = 5
+	}
+	if c.PassiveHealth.FailWindow == 0 {
+		c.PassiveHealth.FailWindow = 30 * time.Second
+	}
+	if len(c.PassiveHealth.UnhealthyStatus) == 0 {
+		c.PassiveHealth.UnhealthyStatus = []int{500, 502, 503, 504}
+	}
+	if c.PassiveHealth.MaxLatency == 0 {
+		c.PassiveHealth.MaxLatency = 2 * time.Second
+	}
+	if c.PassiveHealth.Cooldown == 0 {
+		c.PassiveHealth.Cooldown = 60 * time.Second
+	}
+	if c.DrainTimeout == 0 {
+		c.DrainTimeout = 30 * time.Second
+	}
 }
 
 // Validate performs validation on the configuration.
@@ -87,6 +184,12 @@ func (c *Config) Validate() error {
 	if c.ProxyPort < 1 || c.ProxyPort > 65535 {
 		return fmt.Errorf("proxy_port must be between 1 and 65535, got %d", c.ProxyPort)
 	}
+	if c.AdminPort < 1 || c.AdminPort > 65535 {
+		return fmt.Errorf("admin_port must be between 1 and 65535, got %d", c.AdminPort)
+	}
+	if c.AdminPort == c.ProxyPort {
+		return fmt.Errorf("admin_port must differ from proxy_port, got %d for both", c.AdminPort)
+	}
 	if c.HealthCheckInterval <= 0 {
 		return fmt.Errorf("health_check_interval must be positive, got %v", c.HealthCheckInterval)
 	}
@@ -99,5 +202,35 @@ func (c *Config) Validate() error {
 	if len(c.BackendAddresses) == 0 {
 		return fmt.Errorf("backend_addresses must contain at least one address")
 	}
+	switch c.SelectionPolicy.Type {
+	case "", "ewma_wrc", "round_robin", "random", "least_conn", "ip_hash", "first":
+		// no extra fields required
+	case "header_hash":
+		if c.SelectionPolicy.Header == "" {
+			return fmt.Errorf("selection_policy.header must be set when selection_policy.type is header_hash")
+		}
+	default:
+		return fmt.Errorf("selection_policy.type %q is not a recognized selection policy", c.SelectionPolicy.Type)
+	}
+	switch c.HealthProbe.Type {
+	case "", "http", "tendermint_status", "jsonrpc":
+		// no extra validation required
+	default:
+		return fmt.Errorf("health_probe.type %q is not a recognized health probe", c.HealthProbe.Type)
+	}
+	if c.HealthProbe.ExpectedBodyRegex != "" {
+		if _, err := regexp.Compile(c.HealthProbe.ExpectedBodyRegex); err != nil {
+			return fmt.Errorf("health_probe.expected_body_regex is not a valid regex: %w", err)
+		}
+	}
+	if c.PassiveHealth.MaxFails < 1 {
+		return fmt.Errorf("passive_health.max_fails must be at least 1, got %d", c.PassiveHealth.MaxFails)
+	}
+	if c.PassiveHealth.Cooldown <= 0 {
+		return fmt.Errorf("passive_health.cooldown must be positive, got %v", c.PassiveHealth.Cooldown)
+	}
+	if c.DrainTimeout <= 0 {
+		return fmt.Errorf("drain_timeout must be positive, got %v", c.DrainTimeout)
+	}
 	return nil
 }
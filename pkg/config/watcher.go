@@ -0,0 +1,117 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher holds the live Config for a long-running process, reloaded from
+// disk without a restart. Readers like manager.HealthChecker and
+// UpdateScore's EWMA call Config() on every use instead of capturing a
+// Config by value at startup, so a reload takes effect immediately.
+//
+// ProxyPort and AdminPort are the exception: both are read once by main to
+// bind a listener, and http.ListenAndServe cannot rebind an already-open
+// socket, so changing either still requires a restart.
+type Watcher struct {
+	path    string
+	current atomic.Pointer[Config]
+
+	mu       sync.Mutex
+	onReload []func(old, new *Config)
+}
+
+// NewWatcher wraps an already-loaded Config in a Watcher that reloads from
+// path.
+func NewWatcher(path string, initial *Config) *Watcher {
+	w := &Watcher{path: path}
+	w.current.Store(initial)
+	return w
+}
+
+// Config returns the most recently loaded configuration.
+func (w *Watcher) Config() *Config {
+	return w.current.Load()
+}
+
+// OnReload registers fn to run after every successful Reload, with the
+// replaced and new Config. main uses this to diff BackendAddresses against
+// the live EndpointPool.
+func (w *Watcher) OnReload(fn func(old, new *Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onReload = append(w.onReload, fn)
+}
+
+// Reload re-reads and re-validates w.path and, on success, swaps it in as
+// the current Config and runs every OnReload callback. The previous Config
+// is left in place if the file fails to parse or validate.
+func (w *Watcher) Reload() error {
+	next, err := NewConfig(w.path)
+	if err != nil {
+		return fmt.Errorf("reload %s: %w", w.path, err)
+	}
+
+	old := w.current.Swap(next)
+
+	w.mu.Lock()
+	callbacks := append([]func(old, new *Config){}, w.onReload...)
+	w.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(old, next)
+	}
+	return nil
+}
+
+// Watch blocks, calling Reload whenever the process receives SIGHUP or (if
+// the platform and filesystem support it) w.path changes on disk, until
+// ctx is done. A Reload error is logged and otherwise ignored, so one bad
+// edit doesn't take down the watcher.
+func (w *Watcher) Watch(ctx context.Context) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	var fsEvents <-chan fsnotify.Event
+	if fsw, err := fsnotify.NewWatcher(); err != nil {
+		log.Printf("[ConfigWatcher] fsnotify unavailable, falling back to SIGHUP only: %v", err)
+	} else {
+		defer fsw.Close()
+		if err := fsw.Add(w.path); err != nil {
+			log.Printf("[ConfigWatcher] fsnotify watch on %s failed, falling back to SIGHUP only: %v", w.path, err)
+		} else {
+			fsEvents = fsw.Events
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			log.Printf("[ConfigWatcher] SIGHUP received, reloading %s", w.path)
+		case ev, ok := <-fsEvents:
+			if !ok {
+				fsEvents = nil
+				continue
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			log.Printf("[ConfigWatcher] %s changed, reloading", w.path)
+		}
+
+		if err := w.Reload(); err != nil {
+			log.Printf("[ConfigWatcher] reload failed: %v", err)
+		}
+	}
+}
@@ -3,11 +3,11 @@ package manager
 import (
 	"fmt"
 	"log"
-	"math"
-	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/archway-network/lambo/pkg/config"
@@ -24,12 +24,266 @@ type Endpoint struct {
 	LatencyMs        float64    // Latest measured latency
 	Mutex            sync.Mutex // Protects metrics updates
 	ConsecutiveFails int        // Counter for HealthChecker
+
+	// conns tracks the currently open connections to this endpoint (see
+	// transport.go), so InFlight and CloseAllConnections reflect real
+	// open connections rather than a best-effort request counter.
+	conns map[net.Conn]struct{}
+
+	// transport is the http.RoundTripper built (once) for this endpoint
+	// by Transport(), wrapping the default transport's DialContext to
+	// populate conns and counting requests in flight into activeRequests.
+	transportOnce sync.Once
+	transport     http.RoundTripper
+
+	// activeRequests counts requests currently being round-tripped to
+	// this endpoint (see transport.go's countingRoundTripper). Unlike
+	// InFlight (open connections, which keep-alive leaves lingering idle),
+	// this reflects actual load, so LeastConnPolicy uses it instead.
+	// Accessed atomically.
+	activeRequests int64
+
+	// Passive health / circuit breaker state, populated by RecordOutcome
+	// and consumed by EndpointPool.Select. All guarded by Mutex.
+	passiveOutcomes []passiveOutcome
+	passiveTripped  bool      // true once RecordOutcome has tripped the breaker
+	cooldownUntil   time.Time // when a half-open trial request may be let through
+	trialInFlight   bool      // true while a half-open trial request is outstanding
+
+	// Counters consumed by pkg/admin's /metrics endpoint. Guarded by Mutex.
+	requestTotals     map[int]int64    // response status code -> count (0 = transport error)
+	healthCheckTotals map[string]int64 // "success"/"failure" -> count
+}
+
+// RecordRequestStatus increments the per-status-code request counter
+// exposed by pkg/admin as lambo_requests_total. statusCode 0 represents a
+// transport-level error (no response was received).
+func (e *Endpoint) RecordRequestStatus(statusCode int) {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	if e.requestTotals == nil {
+		e.requestTotals = make(map[int]int64)
+	}
+	e.requestTotals[statusCode]++
+}
+
+// RequestTotals returns a copy of the per-status-code request counts.
+func (e *Endpoint) RequestTotals() map[int]int64 {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	out := make(map[int]int64, len(e.requestTotals))
+	for k, v := range e.requestTotals {
+		out[k] = v
+	}
+	return out
+}
+
+// RecordHealthCheckResult increments the active health check result
+// counter exposed by pkg/admin as lambo_healthcheck_total. result is
+// conventionally "success" or "failure".
+func (e *Endpoint) RecordHealthCheckResult(result string) {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	if e.healthCheckTotals == nil {
+		e.healthCheckTotals = make(map[string]int64)
+	}
+	e.healthCheckTotals[result]++
+}
+
+// HealthCheckTotals returns a copy of the per-result health check counts.
+func (e *Endpoint) HealthCheckTotals() map[string]int64 {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	out := make(map[string]int64, len(e.healthCheckTotals))
+	for k, v := range e.healthCheckTotals {
+		out[k] = v
+	}
+	return out
+}
+
+// InFlight returns the number of connections currently open to this
+// endpoint, as tracked by the transport returned from Transport(). Because
+// of HTTP keep-alive, this includes idle pooled connections as well as
+// ones with a request actually in flight -- RemoveGracefully uses it to
+// know when it's safe to drop the endpoint, not as a load measure. For
+// routing by load, see ActiveRequests.
+func (e *Endpoint) InFlight() int64 {
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+	return int64(len(e.conns))
+}
+
+// ActiveRequests returns the number of requests currently being
+// round-tripped to this endpoint, as tracked by the transport returned
+// from Transport(). Unlike InFlight, an idle keep-alive connection doesn't
+// count, so LeastConnPolicy uses this to route to the least-loaded
+// candidate rather than the one with the fewest pooled connections.
+func (e *Endpoint) ActiveRequests() int64 {
+	return atomic.LoadInt64(&e.activeRequests)
+}
+
+// CloseAllConnections forcibly closes every connection currently open to
+// this endpoint. HealthChecker calls this the moment an endpoint flips
+// unhealthy so a slow-loris or hung upstream is torn down immediately,
+// rather than left for in-flight clients to time out against on their own.
+func (e *Endpoint) CloseAllConnections() {
+	e.Mutex.Lock()
+	conns := make([]net.Conn, 0, len(e.conns))
+	for c := range e.conns {
+		conns = append(conns, c)
+	}
+	e.Mutex.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
 }
 
 // EndpointPool is the thread-safe container for all backend services.
 type EndpointPool struct {
 	Endpoints []*Endpoint
 	Mutex     sync.RWMutex // Protects the slice itself
+
+	// policy determines which healthy endpoint Select hands back for a
+	// given request. Defaults to EWMAWRCPolicy when nil. Guarded by
+	// Mutex -- use SetPolicy to change it after the pool is in use, so a
+	// config reload swapping policies doesn't race Select's read.
+	policy SelectionPolicy
+
+	// BlockHeightTracker records the latest block height observed from
+	// each endpoint by chain-aware health probes, so probes can flag a
+	// backend that has fallen behind the rest of the pool.
+	BlockHeightTracker *BlockHeightTracker
+}
+
+// NewEndpointPool returns an empty EndpointPool ready to have Endpoints
+// populated.
+func NewEndpointPool() *EndpointPool {
+	return &EndpointPool{
+		BlockHeightTracker: NewBlockHeightTracker(),
+	}
+}
+
+// SetPolicy swaps in policy as the SelectionPolicy Select hands candidates
+// off to. Safe to call while requests are being served concurrently (e.g.
+// from a config reload) -- Select reads the policy under the same Mutex.
+func (p *EndpointPool) SetPolicy(policy SelectionPolicy) {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+	p.policy = policy
+}
+
+// --- Pool Membership (2.1) ---
+
+// Add inserts a new endpoint for addr into the pool and returns it. If an
+// endpoint with the same (normalized) address already exists, Add is a
+// no-op and returns the existing Endpoint instead.
+func (p *EndpointPool) Add(addr string) *Endpoint {
+	ep := NewEndpoint(addr)
+
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+
+	for _, existing := range p.Endpoints {
+		if existing.Address == ep.Address {
+			return existing
+		}
+	}
+	p.Endpoints = append(p.Endpoints, ep)
+	log.Printf("[EndpointPool] added endpoint %s", ep.Address)
+	return ep
+}
+
+// Remove drops the endpoint matching addr from the pool entirely, along
+// with its last-observed block height (see BlockHeightTracker.Forget), so
+// a backend that raced ahead or crashed stops counting toward the pool's
+// lag reference once it's gone. Returns false if no such endpoint was
+// found.
+func (p *EndpointPool) Remove(addr string) bool {
+	p.Mutex.Lock()
+	defer p.Mutex.Unlock()
+
+	for i, ep := range p.Endpoints {
+		if ep.Address == addr {
+			p.Endpoints = append(p.Endpoints[:i], p.Endpoints[i+1:]...)
+			p.BlockHeightTracker.Forget(addr)
+			log.Printf("[EndpointPool] removed endpoint %s", addr)
+			return true
+		}
+	}
+	return false
+}
+
+// Drain marks the endpoint matching addr unhealthy without removing it
+// from the pool, so it stops receiving new requests (via Select) while
+// in-flight requests are left to finish on their own. The drain is not
+// persistent: HealthChecker's next successful probe of the endpoint marks
+// it healthy again. Returns false if no such endpoint was found.
+func (p *EndpointPool) Drain(addr string) bool {
+	p.Mutex.RLock()
+	defer p.Mutex.RUnlock()
+
+	for _, ep := range p.Endpoints {
+		if ep.Address == addr {
+			ep.Mutex.Lock()
+			ep.IsHealthy = false
+			ep.Mutex.Unlock()
+			log.Printf("[EndpointPool] drained endpoint %s", addr)
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveGracefully drains the endpoint matching addr (see Drain) and then
+// removes it from the pool once its in-flight connections reach zero or
+// timeout elapses, whichever comes first -- forcibly closing any that are
+// still open at that point via CloseAllConnections. Used by a config
+// reload to drop a backend that fell out of BackendAddresses without
+// cutting off requests already in flight to it. Returns false if no such
+// endpoint was found.
+func (p *EndpointPool) RemoveGracefully(addr string, timeout time.Duration) bool {
+	p.Mutex.RLock()
+	var ep *Endpoint
+	for _, candidate := range p.Endpoints {
+		if candidate.Address == addr {
+			ep = candidate
+			break
+		}
+	}
+	p.Mutex.RUnlock()
+	if ep == nil {
+		return false
+	}
+
+	ep.Mutex.Lock()
+	ep.IsHealthy = false
+	ep.Mutex.Unlock()
+	log.Printf("[EndpointPool] draining endpoint %s (up to %v)", addr, timeout)
+
+	go func() {
+		deadline := time.Now().Add(timeout)
+		for ep.InFlight() > 0 && time.Now().Before(deadline) {
+			time.Sleep(200 * time.Millisecond)
+		}
+		if n := ep.InFlight(); n > 0 {
+			log.Printf("[EndpointPool] %s still has %d connections open after %v, forcing close", addr, n, timeout)
+			ep.CloseAllConnections()
+		}
+		p.Remove(addr)
+	}()
+	return true
+}
+
+// Snapshot returns a point-in-time copy of the pool's endpoint slice, safe
+// to range over without holding p.Mutex.
+func (p *EndpointPool) Snapshot() []*Endpoint {
+	p.Mutex.RLock()
+	defer p.Mutex.RUnlock()
+
+	out := make([]*Endpoint, len(p.Endpoints))
+	copy(out, p.Endpoints)
+	return out
 }
 
 // NewEndpoint creates a new endpoint, parsing the address into a URL object.
@@ -116,129 +370,156 @@ func (e *Endpoint) UpdateScore(success bool, duration time.Duration, ewmaAlpha f
 		e.Address, e.LatencyMs, success, e.Score)
 }
 
-// HealthChecker continuously probes backends and updates their IsHealthy status.
-func HealthChecker(p *EndpointPool, cfg *config.Config) {
+// HealthChecker continuously probes backends and updates their IsHealthy
+// status. Probing happens in two phases each round: every endpoint is
+// probed concurrently first, then (once the pool-wide reference block
+// height is known) each result is evaluated for block-height lag and
+// applied. This ensures every endpoint in a round is judged against the
+// same height snapshot, regardless of probe completion order.
+//
+// cfgWatcher.Config() is re-read at the top of every round rather than
+// captured once, so a config reload's HealthCheckInterval,
+// HealthCheckFailures, and HealthProbe settings take effect on the next
+// round without restarting the process.
+func HealthChecker(p *EndpointPool, cfgWatcher *config.Watcher) {
 	for {
+		cfg := cfgWatcher.Config()
+		probe := NewHealthProbe(cfg.HealthProbe)
+
 		p.Mutex.RLock()
 		endpoints := p.Endpoints
 		p.Mutex.RUnlock()
 
+		results := make([]ProbeResult, len(endpoints))
 		var wg sync.WaitGroup
-		for _, ep := range endpoints {
+		for i, ep := range endpoints {
 			wg.Add(1)
-			go func(ep *Endpoint) {
+			go func(i int, ep *Endpoint) {
 				defer wg.Done()
-				checkBackendHealth(ep, cfg)
-			}(ep)
+				results[i] = probe.Probe(ep, cfg)
+			}(i, ep)
 		}
 		wg.Wait()
+
+		for i, ep := range endpoints {
+			if results[i].HasHeight {
+				p.BlockHeightTracker.Observe(ep.Address, results[i].Height)
+			}
+		}
+		refHeight := p.BlockHeightTracker.Reference()
+
+		for i, ep := range endpoints {
+			applyProbeResult(ep, cfg, results[i], refHeight)
+		}
+
 		time.Sleep(cfg.HealthCheckInterval)
 	}
 }
 
-func checkBackendHealth(ep *Endpoint, cfg *config.Config) {
-	// Mock Health Check: Send a simple GET request
-	client := http.Client{Timeout: 3 * time.Second}
-	// Construct health check URL using the endpoint's base URL and append /health
-	baseURL := ep.URL
-	healthPath := "/health"
-	
-	// If endpoint has a base path, append /health to it
-	if baseURL.Path != "" && baseURL.Path != "/" {
-		// Ensure base path ends with / before appending health
-		if baseURL.Path[len(baseURL.Path)-1] == '/' {
-			healthPath = baseURL.Path + "health"
-		} else {
-			healthPath = baseURL.Path + "/health"
+// applyProbeResult folds a single probe round's outcome (plus the
+// pool-wide reference block height, for probes that report one) into an
+// endpoint's consecutive-failure counter and IsHealthy status.
+func applyProbeResult(ep *Endpoint, cfg *config.Config, result ProbeResult, refHeight int64) {
+	healthy := result.Healthy
+	if healthy && result.HasHeight && cfg.HealthProbe.MaxBlockLag > 0 {
+		if lag := refHeight - result.Height; lag > cfg.HealthProbe.MaxBlockLag {
+			healthy = false
+			result.Err = fmt.Errorf("block height %d lags pool reference %d by %d blocks", result.Height, refHeight, lag)
 		}
 	}
-	
-	// Build the full health check URL
-	healthURL := fmt.Sprintf("%s://%s%s", baseURL.Scheme, baseURL.Host, healthPath)
-	resp, err := client.Get(healthURL)
+
+	if healthy {
+		ep.RecordHealthCheckResult("success")
+	} else {
+		ep.RecordHealthCheckResult("failure")
+	}
 
 	ep.Mutex.Lock()
-	defer ep.Mutex.Unlock()
 
-	if err != nil || resp.StatusCode != http.StatusOK {
+	if !healthy {
 		ep.ConsecutiveFails++
-		log.Printf("[HealthCheck] %s FAILED (%d/%d): %v", ep.Address, ep.ConsecutiveFails, cfg.HealthCheckFailures, err)
+		log.Printf("[HealthCheck] %s FAILED (%d/%d): %v", ep.Address, ep.ConsecutiveFails, cfg.HealthCheckFailures, result.Err)
 
+		justTripped := false
 		if ep.ConsecutiveFails >= cfg.HealthCheckFailures && ep.IsHealthy {
 			ep.IsHealthy = false
+			justTripped = true
 			log.Printf("[HealthCheck] %s marked UNHEALTHY (Policy: Failure Count)", ep.Address)
 		}
-	} else {
-		if !ep.IsHealthy {
-			// Recovery Policy: Reset score to baseline (0.5) when healthy again
-			ep.Score = 0.5
-			log.Printf("[HealthCheck] %s recovered. Score reset to 0.5.", ep.Address)
+		ep.Mutex.Unlock()
+
+		if justTripped {
+			// CloseAllConnections locks ep.Mutex itself, so it must run
+			// after we've released it above.
+			ep.CloseAllConnections()
 		}
-		ep.IsHealthy = true
-		ep.ConsecutiveFails = 0
+		return
 	}
-	if resp != nil {
-		resp.Body.Close()
+
+	if ep.passiveTripped && time.Now().Before(ep.cooldownUntil) {
+		// The passive circuit breaker (see RecordOutcome) tripped this
+		// endpoint and is holding it out of Select's candidates for
+		// cfg.Cooldown. An active probe hitting /health doesn't get a say
+		// until that cooldown elapses -- otherwise a backend that 5xxs
+		// real traffic but 200s its health check would have the passive
+		// trip reset on the very next probe round, defeating the breaker.
+		ep.Mutex.Unlock()
+		return
+	}
+	ep.passiveTripped = false
+
+	if !ep.IsHealthy {
+		// Recovery Policy: Reset score to baseline (0.5) when healthy again
+		ep.Score = 0.5
+		log.Printf("[HealthCheck] %s recovered. Score reset to 0.5.", ep.Address)
 	}
+	ep.IsHealthy = true
+	ep.ConsecutiveFails = 0
+	ep.Mutex.Unlock()
 }
 
 // --- Request Layer (2.3) ---
 
-// Select implements the Weighted Random Choice (WRC) algorithm.
-func (p *EndpointPool) Select() *Endpoint {
+// Select filters the pool down to its healthy endpoints and hands the
+// decision off to p.policy (EWMAWRCPolicy by default).
+func (p *EndpointPool) Select(r *http.Request) *Endpoint {
 	p.Mutex.RLock()
 	defer p.Mutex.RUnlock()
 
-	// 1. Filter: Get all healthy endpoints
+	// 1. Filter: Get all healthy endpoints, plus any endpoint tripped by
+	// the passive health circuit breaker that is due its half-open trial.
+	now := time.Now()
 	var candidates []*Endpoint
 	for _, ep := range p.Endpoints {
 		ep.Mutex.Lock()
-		if ep.IsHealthy {
+		eligible := ep.IsHealthy || ep.eligibleForTrial(now)
+		ep.Mutex.Unlock()
+		if eligible {
 			candidates = append(candidates, ep)
 		}
-		ep.Mutex.Unlock()
 	}
 
 	if len(candidates) == 0 {
 		return nil // No healthy endpoint found
 	}
 
-	// 2. Calculate Effective Weight (Weff)
-	var effectiveWeights []float64
-	var totalWeight float64
-
-	for _, ep := range candidates {
-		ep.Mutex.Lock() // Lock to read metrics
-		score := ep.Score
-		latency := ep.LatencyMs
-		ep.Mutex.Unlock() // Unlock after reading
-
-		// Latency is at least 1ms to prevent log(1) which is zero
-		if latency < 1.0 {
-			latency = 1.0
-		}
-
-		// Calculate Latency Penalty Multiplier: 1 / log2(LatencyMs + 2)
-		// log2(1+2) = 1.58 -> multiplier ~0.63
-		// log2(50+2) = 5.70 -> multiplier ~0.17
-		latencyMultiplier := 1.0 / math.Log2(latency+2)
-
-		// W_eff = S * Multiplier
-		weight := score * latencyMultiplier
-		effectiveWeights = append(effectiveWeights, weight)
-		totalWeight += weight
+	policy := p.policy
+	if policy == nil {
+		policy = &EWMAWRCPolicy{}
 	}
-
-	// 3. Weighted Random Selection
-	r := rand.Float64() * totalWeight
-	var runningWeight float64
-	for i, weight := range effectiveWeights {
-		runningWeight += weight
-		if r <= runningWeight {
-			return candidates[i]
+	chosen := policy.Select(candidates, r)
+
+	// If the policy landed on a not-yet-healthy candidate, it can only be
+	// here via eligibleForTrial above -- mark the trial in-flight now that
+	// we know this is the one request that actually gets sent, so
+	// RecordOutcome has something to resolve and eligibleForTrial won't
+	// offer this endpoint to any other concurrent Select call meanwhile.
+	if chosen != nil {
+		chosen.Mutex.Lock()
+		if !chosen.IsHealthy {
+			chosen.trialInFlight = true
 		}
+		chosen.Mutex.Unlock()
 	}
-	// Should not be reached, but as a safe fallback
-	return candidates[len(candidates)-1]
+	return chosen
 }
-
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/archway-network/lambo/pkg/config"
+)
+
+// --- Request Layer: Passive Health / Circuit Breaking (2.3) ---
+
+// passiveOutcome is one observed request result, kept in a per-endpoint
+// slice pruned to the trailing FailWindow so RecordOutcome can evaluate the
+// failure count and p95 latency over that window.
+type passiveOutcome struct {
+	at       time.Time
+	success  bool
+	duration time.Duration
+}
+
+// RecordOutcome feeds a single request's outcome, as observed by
+// pkg/proxy's ModifyResponse/ErrorHandler, into the endpoint's passive
+// health circuit breaker. Unlike UpdateScore's EWMA (which only reweights
+// selection), enough recent failures here flip IsHealthy immediately and
+// pull the endpoint out of EndpointPool.Select's candidates until
+// cfg.Cooldown has elapsed.
+func (e *Endpoint) RecordOutcome(statusCode int, duration time.Duration, cfg config.PassiveHealthConfig) {
+	if cfg.MaxFails <= 0 {
+		return // passive health disabled
+	}
+	success := statusCode != 0 && !isUnhealthyStatus(statusCode, cfg.UnhealthyStatus)
+	now := time.Now()
+
+	e.Mutex.Lock()
+	defer e.Mutex.Unlock()
+
+	if e.trialInFlight {
+		e.trialInFlight = false
+		if success {
+			e.IsHealthy = true
+			e.passiveTripped = false
+			e.passiveOutcomes = nil
+			log.Printf("[CircuitBreaker] %s trial request succeeded, circuit CLOSED", e.Address)
+		} else {
+			e.cooldownUntil = now.Add(cfg.Cooldown)
+			log.Printf("[CircuitBreaker] %s trial request failed, circuit remains OPEN", e.Address)
+		}
+		return
+	}
+
+	e.passiveOutcomes = append(e.passiveOutcomes, passiveOutcome{at: now, success: success, duration: duration})
+	e.passiveOutcomes = pruneOutcomes(e.passiveOutcomes, now, cfg.FailWindow)
+
+	var fails int
+	for _, o := range e.passiveOutcomes {
+		if !o.success {
+			fails++
+		}
+	}
+	p95 := p95Latency(e.passiveOutcomes)
+
+	if fails > cfg.MaxFails || (cfg.MaxLatency > 0 && p95 > cfg.MaxLatency) {
+		e.IsHealthy = false
+		e.passiveTripped = true
+		e.cooldownUntil = now.Add(cfg.Cooldown)
+		log.Printf("[CircuitBreaker] %s circuit OPEN (fails=%d/%d p95=%v): held out of selection for %v",
+			e.Address, fails, cfg.MaxFails, p95, cfg.Cooldown)
+	}
+}
+
+// eligibleForTrial reports whether e, having tripped its passive circuit
+// breaker, is due the single half-open trial request that probes whether
+// it has recovered. It does not itself mark a trial in-flight: several
+// endpoints can be eligible at once, but only the one the policy actually
+// selects should count as "the" trial, so the caller (EndpointPool.Select)
+// marks trialInFlight on just that endpoint once it knows which one was
+// picked. e.Mutex must be held by the caller.
+func (e *Endpoint) eligibleForTrial(now time.Time) bool {
+	return e.passiveTripped && !e.trialInFlight && !now.Before(e.cooldownUntil)
+}
+
+func isUnhealthyStatus(statusCode int, unhealthyStatus []int) bool {
+	for _, s := range unhealthyStatus {
+		if statusCode == s {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneOutcomes drops outcomes older than window relative to now.
+func pruneOutcomes(outcomes []passiveOutcome, now time.Time, window time.Duration) []passiveOutcome {
+	if window <= 0 {
+		return outcomes
+	}
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(outcomes) && outcomes[i].at.Before(cutoff) {
+		i++
+	}
+	return outcomes[i:]
+}
+
+// p95Latency returns the 95th-percentile latency across outcomes, or 0 if
+// outcomes is empty.
+func p95Latency(outcomes []passiveOutcome) time.Duration {
+	if len(outcomes) == 0 {
+		return 0
+	}
+	durations := make([]time.Duration, len(outcomes))
+	for i, o := range outcomes {
+		durations[i] = o.duration
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	idx := int(float64(len(durations)) * 0.95)
+	if idx >= len(durations) {
+		idx = len(durations) - 1
+	}
+	return durations[idx]
+}
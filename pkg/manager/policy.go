@@ -0,0 +1,171 @@
+package manager
+
+import (
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/archway-network/lambo/pkg/config"
+)
+
+// --- Request Layer: Selection Policies (2.3) ---
+
+// SelectionPolicy chooses one endpoint out of a set of already-healthy
+// candidates for a given inbound request. Implementations must be safe for
+// concurrent use, since Select is called once per request.
+type SelectionPolicy interface {
+	Select(candidates []*Endpoint, r *http.Request) *Endpoint
+}
+
+// NewSelectionPolicy builds the SelectionPolicy described by cfg, falling
+// back to the legacy EWMA-weighted random choice policy when the type is
+// empty or unrecognized.
+func NewSelectionPolicy(cfg config.SelectionPolicyConfig) SelectionPolicy {
+	switch cfg.Type {
+	case "round_robin":
+		return &RoundRobinPolicy{}
+	case "random":
+		return &RandomPolicy{}
+	case "least_conn":
+		return &LeastConnPolicy{}
+	case "ip_hash":
+		return &IPHashPolicy{}
+	case "header_hash":
+		return &HeaderHashPolicy{Header: cfg.Header}
+	case "first":
+		return &FirstPolicy{}
+	case "", "ewma_wrc":
+		return &EWMAWRCPolicy{}
+	default:
+		log.Printf("[SelectionPolicy] unknown type %q, falling back to ewma_wrc", cfg.Type)
+		return &EWMAWRCPolicy{}
+	}
+}
+
+// EWMAWRCPolicy picks an endpoint via Weighted Random Choice, weighting by
+// the EWMA reliability score and penalizing higher latency. This is lambo's
+// original (and default) selection policy.
+type EWMAWRCPolicy struct{}
+
+func (p *EWMAWRCPolicy) Select(candidates []*Endpoint, r *http.Request) *Endpoint {
+	// Calculate Effective Weight (Weff)
+	var effectiveWeights []float64
+	var totalWeight float64
+
+	for _, ep := range candidates {
+		ep.Mutex.Lock() // Lock to read metrics
+		score := ep.Score
+		latency := ep.LatencyMs
+		ep.Mutex.Unlock() // Unlock after reading
+
+		// Latency is at least 1ms to prevent log(1) which is zero
+		if latency < 1.0 {
+			latency = 1.0
+		}
+
+		// Calculate Latency Penalty Multiplier: 1 / log2(LatencyMs + 2)
+		// log2(1+2) = 1.58 -> multiplier ~0.63
+		// log2(50+2) = 5.70 -> multiplier ~0.17
+		latencyMultiplier := 1.0 / math.Log2(latency+2)
+
+		// W_eff = S * Multiplier
+		weight := score * latencyMultiplier
+		effectiveWeights = append(effectiveWeights, weight)
+		totalWeight += weight
+	}
+
+	// Weighted Random Selection
+	rnd := rand.Float64() * totalWeight
+	var runningWeight float64
+	for i, weight := range effectiveWeights {
+		runningWeight += weight
+		if rnd <= runningWeight {
+			return candidates[i]
+		}
+	}
+	// Should not be reached, but as a safe fallback
+	return candidates[len(candidates)-1]
+}
+
+// RoundRobinPolicy cycles through candidates in order, distributing
+// requests evenly regardless of load or latency.
+type RoundRobinPolicy struct {
+	counter uint64
+}
+
+func (p *RoundRobinPolicy) Select(candidates []*Endpoint, r *http.Request) *Endpoint {
+	idx := atomic.AddUint64(&p.counter, 1) - 1
+	return candidates[idx%uint64(len(candidates))]
+}
+
+// RandomPolicy picks a uniformly random candidate, ignoring score and
+// latency entirely.
+type RandomPolicy struct{}
+
+func (p *RandomPolicy) Select(candidates []*Endpoint, r *http.Request) *Endpoint {
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// LeastConnPolicy routes to the candidate with the fewest active
+// requests (see Endpoint.ActiveRequests), breaking ties by candidate
+// order.
+type LeastConnPolicy struct{}
+
+func (p *LeastConnPolicy) Select(candidates []*Endpoint, r *http.Request) *Endpoint {
+	best := candidates[0]
+	bestActive := best.ActiveRequests()
+	for _, ep := range candidates[1:] {
+		if active := ep.ActiveRequests(); active < bestActive {
+			best = ep
+			bestActive = active
+		}
+	}
+	return best
+}
+
+// IPHashPolicy hashes the client's address so the same client IP always
+// lands on the same candidate, useful for naive sticky routing.
+type IPHashPolicy struct{}
+
+func (p *IPHashPolicy) Select(candidates []*Endpoint, r *http.Request) *Endpoint {
+	key := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		key = host
+	}
+	return candidates[hashToIndex(key, len(candidates))]
+}
+
+// HeaderHashPolicy hashes the value of a configured request header (e.g. a
+// session or user-id header) so requests sharing that value are pinned to
+// the same candidate. Falls back to a random candidate when the header is
+// absent from the request.
+type HeaderHashPolicy struct {
+	Header string
+}
+
+func (p *HeaderHashPolicy) Select(candidates []*Endpoint, r *http.Request) *Endpoint {
+	key := r.Header.Get(p.Header)
+	if key == "" {
+		return candidates[rand.Intn(len(candidates))]
+	}
+	return candidates[hashToIndex(key, len(candidates))]
+}
+
+// FirstPolicy always routes to the first healthy candidate, falling over to
+// the next one only once the primary drops out of the healthy set.
+type FirstPolicy struct{}
+
+func (p *FirstPolicy) Select(candidates []*Endpoint, r *http.Request) *Endpoint {
+	return candidates[0]
+}
+
+// hashToIndex hashes key with FNV-1a and maps it into [0, n).
+func hashToIndex(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,293 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/archway-network/lambo/pkg/config"
+)
+
+// --- Management Layer: Health Probes (2.2) ---
+
+// ProbeResult is the outcome of a single HealthProbe.Probe call.
+type ProbeResult struct {
+	Healthy   bool  // Whether the probe itself considers the endpoint healthy
+	HasHeight bool  // Whether Height was populated by a chain-aware probe
+	Height    int64 // Latest observed block height, valid only if HasHeight
+	Err       error // Set when Healthy is false, for logging
+}
+
+// HealthProbe checks a single endpoint and reports its health, optionally
+// alongside a block height for chain-aware probes. Implementations must be
+// safe for concurrent use, since HealthChecker probes every endpoint in a
+// round concurrently.
+type HealthProbe interface {
+	Probe(ep *Endpoint, cfg *config.Config) ProbeResult
+}
+
+// NewHealthProbe builds the HealthProbe described by cfg, falling back to
+// the plain HTTPProbe when the type is empty or unrecognized.
+func NewHealthProbe(cfg config.HealthProbeConfig) HealthProbe {
+	switch cfg.Type {
+	case "tendermint_status":
+		return &TendermintStatusProbe{}
+	case "jsonrpc":
+		return &JSONRPCProbe{Method: cfg.Method}
+	case "", "http":
+		return newHTTPProbe(cfg)
+	default:
+		log.Printf("[HealthProbe] unknown type %q, falling back to http", cfg.Type)
+		return newHTTPProbe(cfg)
+	}
+}
+
+// --- http probe ---
+
+// HTTPProbe reproduces lambo's original health check: a GET against a
+// configurable path, optionally validating the response status and body.
+type HTTPProbe struct {
+	Path           string
+	ExpectedStatus int
+	BodyRegex      *regexp.Regexp
+}
+
+func newHTTPProbe(cfg config.HealthProbeConfig) *HTTPProbe {
+	probe := &HTTPProbe{Path: cfg.Path, ExpectedStatus: cfg.ExpectedStatus}
+	if cfg.ExpectedBodyRegex != "" {
+		re, err := regexp.Compile(cfg.ExpectedBodyRegex)
+		if err != nil {
+			log.Printf("[HealthProbe] invalid expected_body_regex %q: %v", cfg.ExpectedBodyRegex, err)
+		} else {
+			probe.BodyRegex = re
+		}
+	}
+	return probe
+}
+
+func (p *HTTPProbe) Probe(ep *Endpoint, cfg *config.Config) ProbeResult {
+	path := p.Path
+	if path == "" {
+		path = "/health"
+	}
+	expectedStatus := p.ExpectedStatus
+	if expectedStatus == 0 {
+		expectedStatus = http.StatusOK
+	}
+
+	client := http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(probeURL(ep, path))
+	if err != nil {
+		return ProbeResult{Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expectedStatus {
+		return ProbeResult{Err: fmt.Errorf("unexpected status %d (want %d)", resp.StatusCode, expectedStatus)}
+	}
+
+	if p.BodyRegex != nil {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return ProbeResult{Err: fmt.Errorf("reading response body: %w", err)}
+		}
+		if !p.BodyRegex.Match(body) {
+			return ProbeResult{Err: fmt.Errorf("response body did not match expected_body_regex %q", p.BodyRegex.String())}
+		}
+	}
+
+	return ProbeResult{Healthy: true}
+}
+
+// --- tendermint_status probe ---
+
+// TendermintStatusProbe hits a Tendermint/CometBFT `/status` endpoint and
+// marks the node unhealthy while it is still catching up. It always reports
+// the node's latest block height so HealthChecker can apply a pool-wide lag
+// threshold on top.
+type TendermintStatusProbe struct{}
+
+type tendermintStatusResponse struct {
+	Result struct {
+		SyncInfo struct {
+			LatestBlockHeight string `json:"latest_block_height"`
+			CatchingUp        bool   `json:"catching_up"`
+		} `json:"sync_info"`
+	} `json:"result"`
+}
+
+func (p *TendermintStatusProbe) Probe(ep *Endpoint, cfg *config.Config) ProbeResult {
+	client := http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(probeURL(ep, "/status"))
+	if err != nil {
+		return ProbeResult{Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ProbeResult{Err: fmt.Errorf("unexpected status %d from /status", resp.StatusCode)}
+	}
+
+	var status tendermintStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return ProbeResult{Err: fmt.Errorf("decoding /status response: %w", err)}
+	}
+
+	height, err := strconv.ParseInt(status.Result.SyncInfo.LatestBlockHeight, 10, 64)
+	if err != nil {
+		return ProbeResult{Err: fmt.Errorf("parsing latest_block_height %q: %w", status.Result.SyncInfo.LatestBlockHeight, err)}
+	}
+
+	if status.Result.SyncInfo.CatchingUp {
+		return ProbeResult{HasHeight: true, Height: height, Err: fmt.Errorf("node is catching up at height %d", height)}
+	}
+
+	return ProbeResult{Healthy: true, HasHeight: true, Height: height}
+}
+
+// --- jsonrpc probe ---
+
+// JSONRPCProbe POSTs a configurable JSON-RPC method (e.g. eth_blockNumber)
+// and parses the numeric result as a block height, for chains that expose
+// an Ethereum-style JSON-RPC interface instead of Tendermint's /status.
+type JSONRPCProbe struct {
+	Method string
+}
+
+type jsonrpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type jsonrpcResponse struct {
+	Result string `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *JSONRPCProbe) Probe(ep *Endpoint, cfg *config.Config) ProbeResult {
+	method := p.Method
+	if method == "" {
+		method = "eth_blockNumber"
+	}
+
+	reqBody, err := json.Marshal(jsonrpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: []interface{}{}})
+	if err != nil {
+		return ProbeResult{Err: fmt.Errorf("encoding jsonrpc request: %w", err)}
+	}
+
+	client := http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Post(probeURL(ep, ""), "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return ProbeResult{Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ProbeResult{Err: fmt.Errorf("unexpected status %d from %s", resp.StatusCode, method)}
+	}
+
+	var rpcResp jsonrpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return ProbeResult{Err: fmt.Errorf("decoding %s response: %w", method, err)}
+	}
+	if rpcResp.Error != nil {
+		return ProbeResult{Err: fmt.Errorf("%s returned error: %s", method, rpcResp.Error.Message)}
+	}
+
+	height, err := parseBlockNumber(rpcResp.Result)
+	if err != nil {
+		return ProbeResult{Err: fmt.Errorf("parsing %s result %q: %w", method, rpcResp.Result, err)}
+	}
+
+	return ProbeResult{Healthy: true, HasHeight: true, Height: height}
+}
+
+// parseBlockNumber parses a JSON-RPC block height result, which may be a
+// "0x"-prefixed hex string (the common case for eth_blockNumber) or a plain
+// decimal string.
+func parseBlockNumber(s string) (int64, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return strconv.ParseInt(s[2:], 16, 64)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// probeURL builds the full URL for a probe request against ep, joining the
+// endpoint's base path (if any) with path.
+func probeURL(ep *Endpoint, path string) string {
+	base := ep.URL
+	fullPath := path
+	if base.Path != "" && base.Path != "/" {
+		fullPath = strings.TrimSuffix(base.Path, "/") + path
+	}
+	return fmt.Sprintf("%s://%s%s", base.Scheme, base.Host, fullPath)
+}
+
+// --- Block height tracking ---
+
+// BlockHeightTracker records the latest block height observed per backend
+// address so chain-aware health probes can detect a node that has fallen
+// behind the rest of the pool.
+type BlockHeightTracker struct {
+	mutex   sync.RWMutex
+	heights map[string]int64
+}
+
+// NewBlockHeightTracker returns an empty BlockHeightTracker.
+func NewBlockHeightTracker() *BlockHeightTracker {
+	return &BlockHeightTracker{heights: make(map[string]int64)}
+}
+
+// Observe records the latest height seen for addr.
+func (t *BlockHeightTracker) Observe(addr string, height int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.heights[addr] = height
+}
+
+// Forget drops addr's recorded height, e.g. once it has left the pool, so a
+// removed or crashed backend's last-seen height can no longer pull Reference
+// up (or down) for the peers still being judged against it.
+func (t *BlockHeightTracker) Forget(addr string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.heights, addr)
+}
+
+// Reference returns the height the pool's other endpoints are judged
+// against for lag, or 0 if none have reported a height yet. It is the
+// median of all observed heights rather than the raw max: a single backend
+// reporting a corrupt, wildly inflated height (buggy node, bad RPC parse)
+// would otherwise drag every honest node over MaxBlockLag and unhealthy,
+// while the corrupt node itself -- lagging nothing relative to its own
+// bogus number -- stays healthy. With at least three reporting endpoints,
+// the median tolerates that one bad report without every other endpoint
+// needing to agree on an upper bound; with an even count it takes the upper
+// of the two middle heights, so with exactly two it is their max.
+func (t *BlockHeightTracker) Reference() int64 {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if len(t.heights) == 0 {
+		return 0
+	}
+	heights := make([]int64, 0, len(t.heights))
+	for _, h := range t.heights {
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights[len(heights)/2]
+}
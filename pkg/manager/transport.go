@@ -0,0 +1,77 @@
+package manager
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// --- Request Layer: Connection Tracking (2.3) ---
+
+// Transport returns the http.RoundTripper pkg/proxy's reverse proxy should
+// use for requests to this endpoint, built once and cached. It wraps the
+// default transport's DialContext the way k3s's loadbalancer tracks
+// backend connections: every dialed net.Conn is registered into e.conns
+// (guarded by e.Mutex) and removed again on Close, so InFlight and
+// CloseAllConnections reflect connections actually open against this
+// endpoint rather than a best-effort request counter. The transport is
+// further wrapped in a countingRoundTripper so e.activeRequests reflects
+// requests actually in flight, for policies (LeastConnPolicy) that want
+// load rather than open-connection count.
+func (e *Endpoint) Transport() http.RoundTripper {
+	e.transportOnce.Do(func() {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+
+			tc := &trackedConn{Conn: conn, endpoint: e}
+			e.Mutex.Lock()
+			if e.conns == nil {
+				e.conns = make(map[net.Conn]struct{})
+			}
+			e.conns[tc] = struct{}{}
+			e.Mutex.Unlock()
+
+			return tc, nil
+		}
+		e.transport = &countingRoundTripper{RoundTripper: transport, endpoint: e}
+	})
+	return e.transport
+}
+
+// countingRoundTripper wraps a RoundTripper so e.activeRequests is
+// incremented for the duration of each RoundTrip, giving ActiveRequests an
+// accurate in-flight-request count independent of how many connections
+// the underlying transport happens to be keeping open.
+type countingRoundTripper struct {
+	http.RoundTripper
+	endpoint *Endpoint
+}
+
+func (c *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&c.endpoint.activeRequests, 1)
+	defer atomic.AddInt64(&c.endpoint.activeRequests, -1)
+	return c.RoundTripper.RoundTrip(req)
+}
+
+// trackedConn wraps a net.Conn so that closing it - whether by the
+// transport reclaiming an idle connection or the request finishing -
+// unregisters it from its Endpoint's conns set.
+type trackedConn struct {
+	net.Conn
+	endpoint *Endpoint
+}
+
+func (c *trackedConn) Close() error {
+	c.endpoint.Mutex.Lock()
+	delete(c.endpoint.conns, c)
+	c.endpoint.Mutex.Unlock()
+	return c.Conn.Close()
+}
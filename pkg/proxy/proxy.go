@@ -10,13 +10,16 @@ import (
 	"github.com/archway-network/lambo/pkg/manager"
 )
 
-// ProxyHandler handles incoming client requests.
-func ProxyHandler(p *manager.EndpointPool, cfg *config.Config) http.HandlerFunc {
+// ProxyHandler handles incoming client requests. cfgWatcher.Config() is
+// re-read on every request rather than captured once, so a config
+// reload's EWMAAlpha and PassiveHealth settings take effect immediately.
+func ProxyHandler(p *manager.EndpointPool, cfgWatcher *config.Watcher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		cfg := cfgWatcher.Config()
 
 		// 1. Select the optimal backend
-		targetEndpoint := p.Select()
+		targetEndpoint := p.Select(r)
 		if targetEndpoint == nil {
 			log.Println("[ProxyServer] No healthy endpoints available. Failing request.")
 			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
@@ -26,6 +29,13 @@ func ProxyHandler(p *manager.EndpointPool, cfg *config.Config) http.HandlerFunc
 		// 2. Reverse Proxy and Forward Request
 		proxy := httputil.NewSingleHostReverseProxy(targetEndpoint.URL)
 
+		// Route through the endpoint's tracked transport so InFlight
+		// reflects the connections open to this backend, ActiveRequests
+		// (used by the least_conn policy) reflects requests actually in
+		// flight to it, and HealthChecker can tear the connections down the
+		// moment it goes unhealthy.
+		proxy.Transport = targetEndpoint.Transport()
+
 		// Update director to ensure the host and scheme are set correctly for the backend
 		proxy.Director = func(req *http.Request) {
 			// Override the request URL to use the target endpoint's scheme and host
@@ -48,6 +58,13 @@ func ProxyHandler(p *manager.EndpointPool, cfg *config.Config) http.HandlerFunc
 
 			// 4. Critical Step: Report back to ScoreTracker
 			targetEndpoint.UpdateScore(success, duration, cfg.EWMAAlpha)
+
+			// 5. Passive health: react to this outcome immediately, rather
+			// than waiting for the next active health probe.
+			targetEndpoint.RecordOutcome(resp.StatusCode, duration, cfg.PassiveHealth)
+
+			// 6. Track per-status request counts for pkg/admin's /metrics.
+			targetEndpoint.RecordRequestStatus(resp.StatusCode)
 			return nil
 		}
 
@@ -58,6 +75,13 @@ func ProxyHandler(p *manager.EndpointPool, cfg *config.Config) http.HandlerFunc
 			// 4. Critical Step: Report failure to ScoreTracker (Timeout Policy)
 			targetEndpoint.UpdateScore(false, duration, cfg.EWMAAlpha) // Treat error/timeout as failure
 
+			// 5. Passive health: a transport-level error always counts as
+			// a failure, regardless of unhealthy_status.
+			targetEndpoint.RecordOutcome(0, duration, cfg.PassiveHealth)
+
+			// 6. Track per-status request counts for pkg/admin's /metrics.
+			targetEndpoint.RecordRequestStatus(0)
+
 			http.Error(w, "Gateway Timeout or Target Error", http.StatusGatewayTimeout)
 		}
 
@@ -69,4 +93,3 @@ func ProxyHandler(p *manager.EndpointPool, cfg *config.Config) http.HandlerFunc
 		proxy.ServeHTTP(w, r)
 	}
 }
-